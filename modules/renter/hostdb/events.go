@@ -0,0 +1,180 @@
+package hostdb
+
+import (
+	"sync"
+	"time"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// HostEventType identifies what happened to a host in a HostEvent.
+type HostEventType int
+
+// The set of HostEventTypes a subscriber may receive. HostEventScanResult
+// covers both successful and failed scans; callers distinguish the two via
+// the event's Reason.
+const (
+	HostEventInsert HostEventType = iota
+	HostEventRemove
+	HostEventActivate
+	HostEventDeactivate
+	HostEventScanResult
+	HostEventKeyChanged
+)
+
+// HostEventReason explains why a HostEvent occurred.
+type HostEventReason string
+
+// The set of reasons a HostEvent may carry.
+const (
+	ReasonNewAnnouncement   HostEventReason = "new host announced"
+	ReasonScanSuccess       HostEventReason = "scan success"
+	ReasonScanFailure       HostEventReason = "scan failure"
+	ReasonManualRemove      HostEventReason = "manual remove"
+	ReasonKeyChanged        HostEventReason = "public key changed at address"
+	ReasonKeyChangeRejected HostEventReason = "key-change rejection"
+)
+
+// A HostEvent describes a single change to a host's state in the HostDB:
+// insertion, removal, an active/inactive transition, a scan result, or a
+// public-key change at an already-known NetAddress. Subscribers use Height
+// to order events and to resume a subscription with SubscribeHosts.
+type HostEvent struct {
+	Type     HostEventType
+	Height   types.BlockHeight
+	Entry    modules.HostDBEntry
+	Previous modules.HostDBEntry // zero value if the host had no prior state
+	Reason   HostEventReason
+}
+
+// maxEventLog bounds how many past events SubscribeHosts can replay. Older
+// events are discarded once the limit is reached so the log doesn't grow
+// for the life of the process; SubscribeHosts reports via its return value
+// when a requested replay window reaches further back than what's retained.
+const maxEventLog = 1000
+
+// A hostSubscription tracks one SubscribeHosts caller. While its replay
+// goroutine is still delivering historical events, live events handed to
+// deliver by publish are queued rather than sent directly, so that a
+// concurrent publish can never overtake the replay and deliver events out
+// of order; finishReplay flushes the queue once the replay catches up.
+type hostSubscription struct {
+	ch chan<- HostEvent
+
+	mu        sync.Mutex
+	replaying bool
+	queued    []HostEvent
+}
+
+// deliver hands ev to the subscriber, queuing it instead if replay is still
+// in progress. Like the old non-blocking publish loop, a live send that
+// would block is dropped rather than stalling the HostDB; a subscriber that
+// needs a complete history should use a buffered channel and drain it
+// promptly.
+func (s *hostSubscription) deliver(ev HostEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.replaying {
+		s.queued = append(s.queued, ev)
+		return
+	}
+	select {
+	case s.ch <- ev:
+	default:
+	}
+}
+
+// finishReplay marks replay as complete and flushes any live events that
+// arrived (and were queued by deliver) while it was in progress, in the
+// order they were published, before allowing deliver to send directly
+// again.
+func (s *hostSubscription) finishReplay() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, ev := range s.queued {
+		select {
+		case s.ch <- ev:
+		default:
+		}
+	}
+	s.queued = nil
+	s.replaying = false
+}
+
+// publish appends ev to the event log, trimming it to maxEventLog, and
+// delivers it to every current subscriber without blocking. A subscriber
+// that isn't keeping up with live events misses them rather than stalling
+// the HostDB; subscribers that need a complete history should use a
+// buffered channel and drain it promptly.
+func (hdb *HostDB) publish(ev HostEvent) {
+	hdb.eventLog = append(hdb.eventLog, ev)
+	if len(hdb.eventLog) > maxEventLog {
+		hdb.eventLog = hdb.eventLog[len(hdb.eventLog)-maxEventLog:]
+	}
+	for _, s := range hdb.subscribers {
+		s.deliver(ev)
+	}
+}
+
+// SubscribeHosts registers ch to receive HostEvents as they occur, and
+// replays every retained event with Height >= fromHeight so a new
+// subscriber can reconstruct current host state without separately polling
+// AllHosts. Pass zero to request the full retained history.
+//
+// The subscription is registered, still marked as replaying, before the
+// lock is released, so any event published between registration and the
+// replay goroutine actually running is queued by deliver rather than sent
+// immediately; the replay goroutine then sends the captured backlog on a
+// blocking send and finally flushes that queue, so a subscriber always
+// observes replayed events followed by live events in height order, never
+// a live event ahead of the replay that preceded it. complete reports
+// whether the retained log actually reached back to fromHeight; once the
+// log has filled to maxEventLog and its oldest retained event is newer than
+// fromHeight, older events may already have been trimmed and complete is
+// false, so the caller knows to fall back to AllHosts for anything older.
+func (hdb *HostDB) SubscribeHosts(ch chan<- HostEvent, fromHeight types.BlockHeight) (complete bool) {
+	hdb.mu.Lock()
+	complete = len(hdb.eventLog) < maxEventLog || hdb.eventLog[0].Height <= fromHeight
+	replay := make([]HostEvent, 0, len(hdb.eventLog))
+	for _, e := range hdb.eventLog {
+		if e.Height >= fromHeight {
+			replay = append(replay, e)
+		}
+	}
+	sub := &hostSubscription{ch: ch, replaying: true}
+	hdb.subscribers = append(hdb.subscribers, sub)
+	hdb.mu.Unlock()
+
+	go func() {
+		for _, e := range replay {
+			ch <- e
+		}
+		sub.finishReplay()
+	}()
+
+	return complete
+}
+
+// recordScan updates entry's scan history and publishes a HostEventScanResult
+// event carrying the appropriate success/failure reason.
+func (hdb *HostDB) recordScan(entry *hostEntry, success bool) {
+	prev := entry.HostDBEntry
+	entry.recordScan(time.Now(), success)
+
+	reason := ReasonScanFailure
+	if success {
+		reason = ReasonScanSuccess
+	}
+	hdb.publish(HostEvent{
+		Type:     HostEventScanResult,
+		Height:   hdb.blockHeight,
+		Entry:    entry.HostDBEntry,
+		Previous: prev,
+		Reason:   reason,
+	})
+
+	if success {
+		hdb.maybePromoteRotation(entry)
+	}
+}
@@ -0,0 +1,84 @@
+package hostdb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestSubscribeHostsReplaysBeforeDrain verifies that SubscribeHosts'
+// replay reaches a subscriber that only starts draining its channel after
+// SubscribeHosts returns, which is the pattern the doc comment promises.
+// With a non-blocking send, replay delivered inline under hdb.mu is
+// dropped in exactly this case, since nothing is reading yet.
+func TestSubscribeHostsReplaysBeforeDrain(t *testing.T) {
+	hdb := &HostDB{}
+	hdb.publish(HostEvent{Type: HostEventInsert, Height: 1, Entry: modules.HostDBEntry{NetAddress: "1.2.3.4:1234"}})
+	hdb.publish(HostEvent{Type: HostEventInsert, Height: 2, Entry: modules.HostDBEntry{NetAddress: "5.6.7.8:1234"}})
+
+	ch := make(chan HostEvent, 2)
+	complete := hdb.SubscribeHosts(ch, 0)
+	if !complete {
+		t.Fatal("expected replay to be reported complete when nothing has been trimmed")
+	}
+
+	// Only now start draining, mirroring the documented subscriber pattern.
+	var got []HostEvent
+	for i := 0; i < 2; i++ {
+		select {
+		case e := <-ch:
+			got = append(got, e)
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for replayed event %d", i)
+		}
+	}
+
+	if got[0].Height != 1 || got[1].Height != 2 {
+		t.Fatalf("replayed events out of order: %+v", got)
+	}
+}
+
+// TestSubscribeHostsReportsTruncatedReplay verifies that SubscribeHosts
+// reports complete=false when the requested fromHeight reaches further
+// back than what maxEventLog has retained.
+func TestSubscribeHostsReportsTruncatedReplay(t *testing.T) {
+	hdb := &HostDB{}
+	for i := 0; i < maxEventLog+10; i++ {
+		hdb.publish(HostEvent{Type: HostEventScanResult, Height: types.BlockHeight(i)})
+	}
+
+	ch := make(chan HostEvent, maxEventLog)
+	complete := hdb.SubscribeHosts(ch, 0)
+	if complete {
+		t.Fatal("expected replay to be reported incomplete once the log has been trimmed")
+	}
+}
+
+// TestDeactivateReasonMatchesCause verifies that removeNode publishes the
+// reason it was given rather than always reporting a scan failure.
+func TestDeactivateReasonMatchesCause(t *testing.T) {
+	hdb := &HostDB{activeHosts: make(map[modules.NetAddress]*node)}
+	entry := &hostEntry{HostDBEntry: modules.HostDBEntry{NetAddress: "1.2.3.4:1234"}}
+	n := hdb.insertNode(entry)
+
+	ch := make(chan HostEvent, 16)
+	hdb.SubscribeHosts(ch, 0)
+
+	n.removeNode(ReasonManualRemove)
+
+	for {
+		select {
+		case e := <-ch:
+			if e.Type == HostEventDeactivate {
+				if e.Reason != ReasonManualRemove {
+					t.Fatalf("expected deactivate reason %q, got %q", ReasonManualRemove, e.Reason)
+				}
+				return
+			}
+		case <-time.After(time.Second):
+			t.Fatal("did not observe a HostEventDeactivate")
+		}
+	}
+}
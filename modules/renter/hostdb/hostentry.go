@@ -17,14 +17,42 @@ type hostEntry struct {
 	Reliability types.Currency
 	LastScanned time.Time
 	LastSeen    time.Time
+
+	// ScanHistory is a rolling window of the host's most recent scan
+	// results, oldest first, capped at maxScanHistory entries. It is the
+	// input a HostScorer uses to judge historical uptime, and is persisted
+	// alongside the rest of the entry.
+	ScanHistory []ScanRecord
+}
+
+// recordScan appends a scan result to the host's rolling history, trimming
+// the oldest entries once maxScanHistory is exceeded, and updates
+// LastScanned (and, on success, LastSeen).
+func (h *hostEntry) recordScan(t time.Time, success bool) {
+	h.ScanHistory = append(h.ScanHistory, ScanRecord{Timestamp: t, Success: success})
+	if len(h.ScanHistory) > maxScanHistory {
+		h.ScanHistory = h.ScanHistory[len(h.ScanHistory)-maxScanHistory:]
+	}
+	h.LastScanned = t
+	if success {
+		h.LastSeen = t
+	}
 }
 
 // insertHost adds a host entry to the state. The host will be inserted into
 // the set of all hosts, and if it is online and responding to requests it will
 // be put into the list of active hosts.
 //
+// verifiedRotation indicates that the caller has already checked that
+// host's announcement carries a valid signature from the public key
+// previously known at this NetAddress, if any. An announcement that
+// changes the key without that proof is not applied immediately; it is
+// only promoted once it has accrued keyRotationGrace confirmed scans under
+// its own key (see confirmRotation), so that merely controlling an address
+// isn't enough to steal a host's reputation.
+//
 // TODO: Function should return an error.
-func (hdb *HostDB) insertHost(host modules.HostDBEntry) {
+func (hdb *HostDB) insertHost(host modules.HostDBEntry, verifiedRotation bool) {
 	// Remove garbage hosts and local hosts (but allow local hosts in testing).
 	if err := host.NetAddress.IsValid(); err != nil {
 		hdb.log.Debugf("WARN: host '%v' has an invalid NetAddress: %v", host.NetAddress, err)
@@ -32,17 +60,51 @@ func (hdb *HostDB) insertHost(host modules.HostDBEntry) {
 	}
 	// Don't do anything if we've already seen this host and the public key is
 	// the same.
-	if knownHost, exists := hdb.allHosts[host.NetAddress]; exists && bytes.Equal(host.PublicKey.Key, knownHost.PublicKey.Key) {
+	knownHost, exists := hdb.allHosts[host.NetAddress]
+	if exists && bytes.Equal(host.PublicKey.Key, knownHost.PublicKey.Key) {
+		return
+	}
+
+	if exists && !verifiedRotation {
+		if !hdb.confirmRotation(host) {
+			// Tracked as a pending candidate; left untouched until it
+			// either proves itself via a verified signature or accrues
+			// enough confirmed scans. Promotion then happens
+			// automatically from the scan-completion path once that
+			// happens; see maybePromoteRotation.
+			return
+		}
+		// The grace period was already satisfied by the time this
+		// (re-)announcement arrived, e.g. a race with the scan that
+		// would otherwise have promoted it. Promote the tracked
+		// candidate directly rather than duplicating promoteRotation's
+		// logic here.
+		hdb.promoteRotation(host.NetAddress, hdb.pendingRotations[host.NetAddress])
 		return
 	}
 
-	// Create hostEntry and add to allHosts.
 	h := &hostEntry{
 		FirstSeen:   hdb.blockHeight,
 		HostDBEntry: host,
 		Reliability: DefaultReliability,
 	}
-	hdb.allHosts[host.NetAddress] = h
+
+	if exists {
+		// verifiedRotation is set: the caller already checked that this
+		// announcement is signed by the previously-known key, so apply
+		// the rotation immediately instead of waiting out
+		// keyRotationGrace.
+		hdb.promoteRotation(host.NetAddress, h)
+	} else {
+		hdb.allHosts[host.NetAddress] = h
+		hdb.allHostsByKey[hostKey(host.PublicKey)] = h
+		hdb.publish(HostEvent{
+			Type:   HostEventInsert,
+			Height: hdb.blockHeight,
+			Entry:  host,
+			Reason: ReasonNewAnnouncement,
+		})
+	}
 
 	// Add the host to the scan queue. If the scan is successful, the host
 	// will be placed in activeHosts.
@@ -51,19 +113,57 @@ func (hdb *HostDB) insertHost(host modules.HostDBEntry) {
 
 // Remove deletes an entry from the hostdb.
 func (hdb *HostDB) removeHost(addr modules.NetAddress) error {
+	entry, known := hdb.allHosts[addr]
+
 	// See if the node is in the set of active hosts.
 	node, exists := hdb.activeHosts[addr]
 	if exists {
-		node.removeNode()
+		node.removeNode(ReasonManualRemove)
 		delete(hdb.activeHosts, addr)
 	}
 
-	// Remove the node from all hosts.
+	// Remove the node from all hosts and from the key index.
 	delete(hdb.allHosts, addr)
+	if known {
+		delete(hdb.allHostsByKey, hostKey(entry.PublicKey))
+	}
+	delete(hdb.pendingRotations, addr)
+
+	if known {
+		hdb.publish(HostEvent{
+			Type:   HostEventRemove,
+			Height: hdb.blockHeight,
+			Entry:  entry.HostDBEntry,
+			Reason: ReasonManualRemove,
+		})
+	}
 
 	return nil
 }
 
+// removeHostByKey behaves like removeHost, but looks the host up by its
+// public key rather than its current NetAddress. It is a no-op if no host
+// is known under pk.
+func (hdb *HostDB) removeHostByKey(pk types.SiaPublicKey) error {
+	entry, ok := hdb.allHostsByKey[hostKey(pk)]
+	if !ok {
+		return nil
+	}
+	return hdb.removeHost(entry.NetAddress)
+}
+
+// RemoveHostByKey removes the host known under pk, regardless of which
+// NetAddress it currently announces from. Callers that track hosts by
+// public key (see HostByKey, IsOfflineByKey) rather than NetAddress should
+// use this instead of removeHost, since a host can re-announce under the
+// same key from a different NetAddress. It is a no-op if no host is known
+// under pk.
+func (hdb *HostDB) RemoveHostByKey(pk types.SiaPublicKey) error {
+	hdb.mu.Lock()
+	defer hdb.mu.Unlock()
+	return hdb.removeHostByKey(pk)
+}
+
 // Host returns the HostSettings associated with the specified NetAddress. If
 // no matching host is found, Host returns false.
 func (hdb *HostDB) Host(addr modules.NetAddress) (modules.HostDBEntry, bool) {
@@ -77,7 +177,8 @@ func (hdb *HostDB) Host(addr modules.NetAddress) (modules.HostDBEntry, bool) {
 }
 
 // ActiveHosts returns the hosts that can be randomly selected out of the
-// hostdb, sorted by preference.
+// hostdb, in the order of a weighted random draw by the current HostScorer
+// (see HostDB.SetScorer), so higher-scoring hosts tend to come first.
 func (hdb *HostDB) ActiveHosts() (activeHosts []modules.HostDBEntry) {
 	hdb.mu.RLock()
 	numHosts := len(hdb.activeHosts)
@@ -121,17 +222,34 @@ func (hdb *HostDB) AverageContractPrice() types.Currency {
 // three days, IsOffline will scan it, so the caller should treat this call as
 // blocking. If the host is not present in the HostDB, IsOffline returns false.
 func (hdb *HostDB) IsOffline(addr modules.NetAddress) bool {
-	// lookup entry
 	hdb.mu.RLock()
-	var lastSeen, lastScanned time.Time
 	entry, ok := hdb.allHosts[addr]
-	if ok {
-		lastSeen, lastScanned = entry.LastSeen, entry.LastScanned
+	hdb.mu.RUnlock()
+	if !ok {
+		return false
 	}
+	return hdb.isEntryOffline(addr, entry)
+}
+
+// IsOfflineByKey behaves like IsOffline, but looks the host up by its
+// public key rather than its current NetAddress, so callers keep working
+// when a host re-announces from a different NetAddress (see HostByKey).
+// After a key rotation the old key is no longer indexed, and IsOfflineByKey
+// reports false for it.
+func (hdb *HostDB) IsOfflineByKey(pk types.SiaPublicKey) bool {
+	hdb.mu.RLock()
+	entry, ok := hdb.allHostsByKey[hostKey(pk)]
 	hdb.mu.RUnlock()
 	if !ok {
 		return false
 	}
+	return hdb.isEntryOffline(entry.NetAddress, entry)
+}
+
+// isEntryOffline holds the shared IsOffline/IsOfflineByKey logic once the
+// entry has been looked up by whichever key the caller used.
+func (hdb *HostDB) isEntryOffline(addr modules.NetAddress, entry *hostEntry) bool {
+	lastSeen, lastScanned := entry.LastSeen, entry.LastScanned
 
 	if time.Since(lastScanned) > uptimeThreshold {
 		// if entry hasn't been scanned in the last 3 days, scan it now
@@ -0,0 +1,122 @@
+package hostdb
+
+import (
+	"crypto/rand"
+	"math/big"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// node is an entry in the HostDB's set of active hosts. Nodes are selected
+// by RandomHosts in proportion to their weight, which is assigned by the
+// current HostScorer.
+type node struct {
+	hdb   *HostDB
+	index int
+	entry *hostEntry
+}
+
+// removeNode removes n from the set of active hosts (both hdb.activeNodes,
+// the weighted list RandomHosts draws from, and hdb.activeHosts, the
+// by-address index removeHost looks nodes up in) and publishes a
+// HostEventDeactivate carrying reason. Removal from activeNodes is O(1): n
+// is swapped with the last node in the list, and the list is truncated.
+func (n *node) removeNode(reason HostEventReason) {
+	list := n.hdb.activeNodes
+	last := len(list) - 1
+	list[n.index] = list[last]
+	list[n.index].index = n.index
+	list[last] = nil
+	n.hdb.activeNodes = list[:last]
+	delete(n.hdb.activeHosts, n.entry.NetAddress)
+
+	n.hdb.publish(HostEvent{
+		Type:   HostEventDeactivate,
+		Height: n.hdb.blockHeight,
+		Entry:  n.entry.HostDBEntry,
+		Reason: reason,
+	})
+}
+
+// insertNode scores entry with the HostDB's current HostScorer and adds it
+// to the set of active hosts, both the weighted list RandomHosts draws
+// from and the by-address index removeHost looks nodes up in.
+func (hdb *HostDB) insertNode(entry *hostEntry) *node {
+	entry.Weight = hdb.scoreHost(entry)
+	n := &node{hdb: hdb, index: len(hdb.activeNodes), entry: entry}
+	hdb.activeNodes = append(hdb.activeNodes, n)
+	hdb.activeHosts[entry.NetAddress] = n
+
+	hdb.publish(HostEvent{
+		Type:   HostEventActivate,
+		Height: hdb.blockHeight,
+		Entry:  entry.HostDBEntry,
+		Reason: ReasonScanSuccess,
+	})
+	return n
+}
+
+// RandomHosts returns up to n unique hosts from the set of active hosts,
+// excluding any host whose NetAddress appears in exclude. Hosts are drawn
+// without replacement, weighted by the score the current HostScorer
+// assigns them, so a higher-scoring host is proportionally more likely to
+// be returned but no active host is ever categorically excluded from
+// consideration.
+func (hdb *HostDB) RandomHosts(n int, exclude []modules.NetAddress) []modules.HostDBEntry {
+	hdb.mu.Lock()
+	defer hdb.mu.Unlock()
+
+	excludeSet := make(map[modules.NetAddress]struct{}, len(exclude))
+	for _, addr := range exclude {
+		excludeSet[addr] = struct{}{}
+	}
+
+	candidates := make([]*node, 0, len(hdb.activeNodes))
+	weights := make([]types.Currency, 0, len(hdb.activeNodes))
+	var total types.Currency
+	for _, nd := range hdb.activeNodes {
+		if _, skip := excludeSet[nd.entry.NetAddress]; skip {
+			continue
+		}
+		nd.entry.Weight = hdb.scoreHost(nd.entry)
+		candidates = append(candidates, nd)
+		weights = append(weights, nd.entry.Weight)
+		total = total.Add(nd.entry.Weight)
+	}
+
+	var hosts []modules.HostDBEntry
+	for len(hosts) < n && len(candidates) > 0 {
+		var i int
+		if total.IsZero() {
+			// No remaining candidate has positive weight; fall back to a
+			// uniform pick so callers still get hosts.
+			idx, err := rand.Int(rand.Reader, big.NewInt(int64(len(candidates))))
+			if err != nil {
+				break
+			}
+			i = int(idx.Int64())
+		} else {
+			target, err := rand.Int(rand.Reader, total.Big())
+			if err != nil {
+				break
+			}
+			var sum types.Currency
+			for ; i < len(weights); i++ {
+				sum = sum.Add(weights[i])
+				if sum.Cmp(types.NewCurrency(target)) > 0 {
+					break
+				}
+			}
+			if i == len(weights) {
+				i = len(weights) - 1
+			}
+		}
+
+		hosts = append(hosts, candidates[i].entry.HostDBEntry)
+		total = total.Sub(weights[i])
+		candidates = append(candidates[:i], candidates[i+1:]...)
+		weights = append(weights[:i], weights[i+1:]...)
+	}
+	return hosts
+}
@@ -0,0 +1,40 @@
+package hostdb
+
+import (
+	"testing"
+
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+// TestInsertNodeActivatesHost verifies that insertNode makes a host
+// reachable through both ActiveHosts and removeHost, rather than only
+// appending it to the weighted list RandomHosts draws from. Before
+// insertNode also populated hdb.activeHosts, ActiveHosts (which counts
+// entries in that map) always reported zero hosts, and removeHost's
+// activeHosts lookup never found anything to remove.
+func TestInsertNodeActivatesHost(t *testing.T) {
+	hdb := newTestHostDB(t)
+	addr := modules.NetAddress("1.2.3.4:1234")
+	entry := &hostEntry{HostDBEntry: modules.HostDBEntry{NetAddress: addr}}
+	hdb.allHosts[addr] = entry
+
+	hdb.insertNode(entry)
+
+	active := hdb.ActiveHosts()
+	if len(active) != 1 {
+		t.Fatalf("expected 1 active host after insertNode, got %d", len(active))
+	}
+	if active[0].NetAddress != addr {
+		t.Fatalf("active host has the wrong address: %v", active[0].NetAddress)
+	}
+
+	if err := hdb.removeHost(addr); err != nil {
+		t.Fatal(err)
+	}
+	if active := hdb.ActiveHosts(); len(active) != 0 {
+		t.Fatalf("expected 0 active hosts after removeHost, got %d", len(active))
+	}
+	if _, ok := hdb.activeHosts[addr]; ok {
+		t.Fatal("removeHost left the node behind in hdb.activeHosts")
+	}
+}
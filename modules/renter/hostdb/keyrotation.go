@@ -0,0 +1,185 @@
+package hostdb
+
+import (
+	"bytes"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// keyRotationGrace is the number of consecutive successful scans an
+// unverified new key must accrue at an already-known NetAddress before it
+// is allowed to replace the existing host. This bounds how quickly an
+// attacker who merely controls the address (but not the old key) can steal
+// a host's reputation out from under it.
+const keyRotationGrace = 3
+
+// hostKey returns the string form of pk for use as a map key.
+// types.SiaPublicKey itself isn't comparable, since its Key field is a
+// []byte, so allHostsByKey is indexed by this string instead.
+func hostKey(pk types.SiaPublicKey) string {
+	return pk.String()
+}
+
+// HostByKey returns the host entry known under the given public key,
+// regardless of which NetAddress it currently announces from. If no
+// matching host is found, HostByKey returns false.
+func (hdb *HostDB) HostByKey(pk types.SiaPublicKey) (modules.HostDBEntry, bool) {
+	hdb.mu.Lock()
+	defer hdb.mu.Unlock()
+	entry, ok := hdb.allHostsByKey[hostKey(pk)]
+	if !ok || entry == nil {
+		return modules.HostDBEntry{}, false
+	}
+	return entry.HostDBEntry, true
+}
+
+// siaPublicKeyToCryptoKey extracts the raw ed25519 key bytes from a
+// types.SiaPublicKey for use with the crypto package's signature
+// verification.
+func siaPublicKeyToCryptoKey(spk types.SiaPublicKey) (pk crypto.PublicKey) {
+	copy(pk[:], spk.Key)
+	return
+}
+
+// verifyRotationSignature reports whether sig is a valid signature by
+// oldKey over newKey, which is what an operator performing a legitimate,
+// voluntary key rotation would produce and publish alongside the new
+// announcement.
+func verifyRotationSignature(oldKey, newKey types.SiaPublicKey, sig crypto.Signature) bool {
+	hash := crypto.HashObject(newKey)
+	return crypto.VerifyHash(hash, siaPublicKeyToCryptoKey(oldKey), sig) == nil
+}
+
+// InsertAnnouncement is the entry point external callers (e.g. the
+// consensus subscriber that decodes host announcement transactions) use to
+// feed a freshly-seen host announcement into the HostDB. rotationSig, if
+// non-nil, must be a signature by the key previously known at host's
+// NetAddress over host.PublicKey; a valid rotationSig authorizes an
+// immediate key rotation, skipping keyRotationGrace's wait for confirmed
+// scans. Callers that can't supply one (or are inserting a brand new host)
+// should pass nil.
+func (hdb *HostDB) InsertAnnouncement(host modules.HostDBEntry, rotationSig *crypto.Signature) {
+	hdb.mu.Lock()
+	defer hdb.mu.Unlock()
+
+	var verified bool
+	if rotationSig != nil {
+		if known, exists := hdb.allHosts[host.NetAddress]; exists {
+			verified = verifyRotationSignature(known.PublicKey, host.PublicKey, *rotationSig)
+		}
+	}
+	hdb.insertHost(host, verified)
+}
+
+// rotationConfirmations returns the number of consecutive successful scans
+// at the end of h's scan history.
+func (h *hostEntry) rotationConfirmations() int {
+	var streak int
+	for i := len(h.ScanHistory) - 1; i >= 0; i-- {
+		if !h.ScanHistory[i].Success {
+			break
+		}
+		streak++
+	}
+	return streak
+}
+
+// confirmRotation decides whether an unverified new key announced at an
+// already-known NetAddress may replace the existing host. The candidate is
+// tracked in hdb.pendingRotations and scanned like any other host; once it
+// has accrued keyRotationGrace confirmed scans under its own key,
+// confirmRotation returns true and the caller may promote it. Until then
+// every repeated announcement is logged and published as a rejected
+// rotation, and the existing host entry is left untouched.
+func (hdb *HostDB) confirmRotation(host modules.HostDBEntry) bool {
+	candidate, tracked := hdb.pendingRotations[host.NetAddress]
+	if !tracked || !bytes.Equal(candidate.PublicKey.Key, host.PublicKey.Key) {
+		candidate = &hostEntry{
+			FirstSeen:   hdb.blockHeight,
+			HostDBEntry: host,
+			Reliability: DefaultReliability,
+		}
+		hdb.pendingRotations[host.NetAddress] = candidate
+		hdb.queueHostEntry(candidate)
+	}
+
+	confirmations := candidate.rotationConfirmations()
+	if confirmations >= keyRotationGrace {
+		return true
+	}
+	hdb.log.Printf("WARN: rejecting unverified key rotation for %v (%v/%v confirmed scans)",
+		host.NetAddress, confirmations, keyRotationGrace)
+
+	var previous modules.HostDBEntry
+	if known, ok := hdb.allHosts[host.NetAddress]; ok {
+		previous = known.HostDBEntry
+	}
+	hdb.publish(HostEvent{
+		Type:     HostEventKeyChanged,
+		Height:   hdb.blockHeight,
+		Entry:    host,
+		Previous: previous,
+		Reason:   ReasonKeyChangeRejected,
+	})
+
+	return false
+}
+
+// maybePromoteRotation checks whether entry is a tracked pending-rotation
+// candidate that has just accrued enough confirmed scans to replace the
+// existing host at its NetAddress, promoting it if so. It is called after
+// every successful scan (see recordScan) so that a legitimate rotation
+// completes on its own once the grace period is satisfied, rather than
+// requiring the operator to pay for and broadcast a second announcement.
+func (hdb *HostDB) maybePromoteRotation(entry *hostEntry) {
+	addr := entry.NetAddress
+	candidate, tracked := hdb.pendingRotations[addr]
+	if !tracked || candidate != entry {
+		return
+	}
+	if candidate.rotationConfirmations() < keyRotationGrace {
+		return
+	}
+	hdb.promoteRotation(addr, candidate)
+}
+
+// promoteRotation replaces the existing host at addr (if any) with
+// candidate, which has already satisfied the rotation policy via either a
+// verified signature or the confirmed-scan grace period, and publishes the
+// resulting key-change event. The replaced entry's reputation (FirstSeen
+// and ScanHistory) carries over to candidate, since a legitimate rotation
+// shouldn't cost the host its accrued history, and its node (if active) is
+// retired from hdb.activeNodes/activeHosts so RandomHosts doesn't keep
+// returning a stale entry for the same NetAddress alongside the new one.
+func (hdb *HostDB) promoteRotation(addr modules.NetAddress, candidate *hostEntry) {
+	old, exists := hdb.allHosts[addr]
+
+	delete(hdb.pendingRotations, addr)
+	hdb.allHosts[addr] = candidate
+	hdb.allHostsByKey[hostKey(candidate.PublicKey)] = candidate
+
+	var previous modules.HostDBEntry
+	if exists {
+		delete(hdb.allHostsByKey, hostKey(old.PublicKey))
+		previous = old.HostDBEntry
+
+		candidate.FirstSeen = old.FirstSeen
+		candidate.ScanHistory = append(old.ScanHistory, candidate.ScanHistory...)
+		if len(candidate.ScanHistory) > maxScanHistory {
+			candidate.ScanHistory = candidate.ScanHistory[len(candidate.ScanHistory)-maxScanHistory:]
+		}
+
+		if node, active := hdb.activeHosts[addr]; active && node.entry == old {
+			node.removeNode(ReasonKeyChanged)
+		}
+	}
+	hdb.publish(HostEvent{
+		Type:     HostEventKeyChanged,
+		Height:   hdb.blockHeight,
+		Entry:    candidate.HostDBEntry,
+		Previous: previous,
+		Reason:   ReasonKeyChanged,
+	})
+}
@@ -0,0 +1,260 @@
+package hostdb
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/persist"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// newTestHostDB returns a HostDB with just enough state initialized for
+// the insertHost/key-rotation code paths under test.
+func newTestHostDB(t *testing.T) *HostDB {
+	log, err := persist.NewLogger(ioutil.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &HostDB{
+		log:              log,
+		allHosts:         make(map[modules.NetAddress]*hostEntry),
+		allHostsByKey:    make(map[string]*hostEntry),
+		activeHosts:      make(map[modules.NetAddress]*node),
+		pendingRotations: make(map[modules.NetAddress]*hostEntry),
+	}
+}
+
+// TestKeyRotationPromotesAfterGrace verifies that an unverified key
+// rotation is rejected until it accrues keyRotationGrace confirmed scans,
+// and is then promoted automatically (without requiring a second
+// announcement) once it does.
+func TestKeyRotationPromotesAfterGrace(t *testing.T) {
+	hdb := newTestHostDB(t)
+	addr := modules.NetAddress("1.2.3.4:1234")
+	oldKey := types.SiaPublicKey{Key: []byte("old-key")}
+	newKey := types.SiaPublicKey{Key: []byte("new-key")}
+
+	old := &hostEntry{HostDBEntry: modules.HostDBEntry{PublicKey: oldKey, NetAddress: addr}}
+	hdb.allHosts[addr] = old
+	hdb.allHostsByKey[hostKey(oldKey)] = old
+
+	newHost := modules.HostDBEntry{PublicKey: newKey, NetAddress: addr}
+
+	// An unverified rotation with no confirmed scans yet must be rejected
+	// and merely tracked.
+	hdb.insertHost(newHost, false)
+	if _, ok := hdb.HostByKey(newKey); ok {
+		t.Fatal("unverified rotation was accepted before any confirmed scans")
+	}
+	if hdb.allHosts[addr] != old {
+		t.Fatal("existing host entry was replaced before the rotation was authorized")
+	}
+	candidate, tracked := hdb.pendingRotations[addr]
+	if !tracked {
+		t.Fatal("rotation candidate was not tracked")
+	}
+
+	// Accrue enough confirmed scans to satisfy the grace period. Each
+	// successful recordScan should check for promotion on its own.
+	for i := 0; i < keyRotationGrace; i++ {
+		hdb.recordScan(candidate, true)
+	}
+
+	got, ok := hdb.HostByKey(newKey)
+	if !ok {
+		t.Fatal("rotation was not promoted automatically after accruing enough confirmed scans")
+	}
+	if got.NetAddress != addr {
+		t.Fatalf("promoted host has the wrong address: %v", got.NetAddress)
+	}
+	if _, ok := hdb.HostByKey(oldKey); ok {
+		t.Fatal("old key is still indexed after the rotation completed")
+	}
+	if _, tracked := hdb.pendingRotations[addr]; tracked {
+		t.Fatal("candidate is still tracked as pending after being promoted")
+	}
+}
+
+// TestKeyRotationRejectsIncompleteGrace verifies that a failed scan resets
+// the confirmation streak, so the rotation is not promoted early.
+func TestKeyRotationRejectsIncompleteGrace(t *testing.T) {
+	hdb := newTestHostDB(t)
+	addr := modules.NetAddress("9.9.9.9:1234")
+	oldKey := types.SiaPublicKey{Key: []byte("old-key-3")}
+	newKey := types.SiaPublicKey{Key: []byte("new-key-3")}
+
+	old := &hostEntry{HostDBEntry: modules.HostDBEntry{PublicKey: oldKey, NetAddress: addr}}
+	hdb.allHosts[addr] = old
+	hdb.allHostsByKey[hostKey(oldKey)] = old
+
+	hdb.insertHost(modules.HostDBEntry{PublicKey: newKey, NetAddress: addr}, false)
+	candidate := hdb.pendingRotations[addr]
+
+	hdb.recordScan(candidate, true)
+	hdb.recordScan(candidate, false) // resets the streak
+	hdb.recordScan(candidate, true)
+
+	if _, ok := hdb.HostByKey(newKey); ok {
+		t.Fatal("rotation was promoted despite the confirmation streak being broken")
+	}
+}
+
+// TestRemoveHostByKey verifies that RemoveHostByKey removes a host looked
+// up by its public key, and is a no-op for an unknown key.
+func TestRemoveHostByKey(t *testing.T) {
+	hdb := newTestHostDB(t)
+	addr := modules.NetAddress("6.6.6.6:1234")
+	pk := types.SiaPublicKey{Key: []byte("key-7")}
+
+	entry := &hostEntry{HostDBEntry: modules.HostDBEntry{PublicKey: pk, NetAddress: addr}}
+	hdb.allHosts[addr] = entry
+	hdb.allHostsByKey[hostKey(pk)] = entry
+
+	if err := hdb.RemoveHostByKey(types.SiaPublicKey{Key: []byte("unknown")}); err != nil {
+		t.Fatalf("unexpected error removing an unknown key: %v", err)
+	}
+	if _, ok := hdb.HostByKey(pk); !ok {
+		t.Fatal("RemoveHostByKey removed the wrong host for an unknown key")
+	}
+
+	if err := hdb.RemoveHostByKey(pk); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := hdb.HostByKey(pk); ok {
+		t.Fatal("host is still indexed by key after RemoveHostByKey")
+	}
+	if _, ok := hdb.allHosts[addr]; ok {
+		t.Fatal("host is still present in allHosts after RemoveHostByKey")
+	}
+}
+
+// TestKeyRotationVerifiedSignatureSkipsGrace verifies that InsertAnnouncement
+// applies a rotation immediately when it carries a valid signature from the
+// previously-known key, without waiting on any scans.
+func TestKeyRotationVerifiedSignatureSkipsGrace(t *testing.T) {
+	hdb := newTestHostDB(t)
+	addr := modules.NetAddress("5.6.7.8:1234")
+
+	oldPub, oldPriv := crypto.GenerateKeyPair()
+	oldKey := types.Ed25519PublicKey(oldPub)
+	newKey := types.SiaPublicKey{Key: []byte("new-key-2")}
+
+	old := &hostEntry{HostDBEntry: modules.HostDBEntry{PublicKey: oldKey, NetAddress: addr}}
+	hdb.allHosts[addr] = old
+	hdb.allHostsByKey[hostKey(oldKey)] = old
+
+	newHost := modules.HostDBEntry{PublicKey: newKey, NetAddress: addr}
+	sig := crypto.SignHash(crypto.HashObject(newKey), oldPriv)
+
+	hdb.InsertAnnouncement(newHost, &sig)
+
+	if _, ok := hdb.HostByKey(newKey); !ok {
+		t.Fatal("verified rotation was not applied immediately")
+	}
+	if _, ok := hdb.pendingRotations[addr]; ok {
+		t.Fatal("verified rotation was tracked as pending instead of applied directly")
+	}
+}
+
+// TestPromoteRotationRetiresOldNode verifies that promoteRotation removes
+// the replaced entry's node from the active set, so RandomHosts doesn't
+// return both the old and the new entry for the same NetAddress.
+func TestPromoteRotationRetiresOldNode(t *testing.T) {
+	hdb := newTestHostDB(t)
+	addr := modules.NetAddress("3.3.3.3:1234")
+
+	oldPub, oldPriv := crypto.GenerateKeyPair()
+	oldKey := types.Ed25519PublicKey(oldPub)
+	newKey := types.SiaPublicKey{Key: []byte("new-key-5")}
+
+	old := &hostEntry{HostDBEntry: modules.HostDBEntry{PublicKey: oldKey, NetAddress: addr}}
+	hdb.allHosts[addr] = old
+	hdb.allHostsByKey[hostKey(oldKey)] = old
+	hdb.insertNode(old)
+
+	newHost := modules.HostDBEntry{PublicKey: newKey, NetAddress: addr}
+	sig := crypto.SignHash(crypto.HashObject(newKey), oldPriv)
+	hdb.InsertAnnouncement(newHost, &sig)
+
+	if _, ok := hdb.activeHosts[addr]; ok {
+		t.Fatal("old node is still active after a verified rotation")
+	}
+	active := hdb.RandomHosts(10, nil)
+	for _, h := range active {
+		if h.PublicKey.String() == oldKey.String() {
+			t.Fatal("RandomHosts still returns the pre-rotation host")
+		}
+	}
+}
+
+// TestPromoteRotationCarriesOverReputation verifies that a legitimate
+// rotation (verified signature or completed grace period) doesn't cost the
+// host its accrued FirstSeen/ScanHistory by starting the new entry over
+// from scratch.
+func TestPromoteRotationCarriesOverReputation(t *testing.T) {
+	hdb := newTestHostDB(t)
+	hdb.blockHeight = 100
+	addr := modules.NetAddress("4.4.4.4:1234")
+
+	oldPub, oldPriv := crypto.GenerateKeyPair()
+	oldKey := types.Ed25519PublicKey(oldPub)
+	newKey := types.SiaPublicKey{Key: []byte("new-key-6")}
+
+	old := &hostEntry{
+		HostDBEntry: modules.HostDBEntry{PublicKey: oldKey, NetAddress: addr},
+		FirstSeen:   10,
+		ScanHistory: []ScanRecord{{Success: true}, {Success: true}},
+	}
+	hdb.allHosts[addr] = old
+	hdb.allHostsByKey[hostKey(oldKey)] = old
+
+	newHost := modules.HostDBEntry{PublicKey: newKey, NetAddress: addr}
+	sig := crypto.SignHash(crypto.HashObject(newKey), oldPriv)
+	hdb.InsertAnnouncement(newHost, &sig)
+
+	promoted, ok := hdb.HostByKey(newKey)
+	if !ok {
+		t.Fatal("rotation was not promoted")
+	}
+	if promoted.NetAddress != addr {
+		t.Fatalf("promoted host has the wrong address: %v", promoted.NetAddress)
+	}
+	got := hdb.allHosts[addr]
+	if got.FirstSeen != 10 {
+		t.Fatalf("expected FirstSeen to carry over from the replaced entry, got %v", got.FirstSeen)
+	}
+	if len(got.ScanHistory) != 2 {
+		t.Fatalf("expected ScanHistory to carry over from the replaced entry, got %v", got.ScanHistory)
+	}
+}
+
+// TestKeyRotationRejectsBadSignature verifies that InsertAnnouncement falls
+// back to the grace-period policy when the supplied signature doesn't
+// verify against the previously-known key.
+func TestKeyRotationRejectsBadSignature(t *testing.T) {
+	hdb := newTestHostDB(t)
+	addr := modules.NetAddress("2.2.2.2:1234")
+
+	oldPub, _ := crypto.GenerateKeyPair()
+	_, otherPriv := crypto.GenerateKeyPair()
+	oldKey := types.Ed25519PublicKey(oldPub)
+	newKey := types.SiaPublicKey{Key: []byte("new-key-4")}
+
+	old := &hostEntry{HostDBEntry: modules.HostDBEntry{PublicKey: oldKey, NetAddress: addr}}
+	hdb.allHosts[addr] = old
+	hdb.allHostsByKey[hostKey(oldKey)] = old
+
+	newHost := modules.HostDBEntry{PublicKey: newKey, NetAddress: addr}
+	badSig := crypto.SignHash(crypto.HashObject(newKey), otherPriv)
+
+	hdb.InsertAnnouncement(newHost, &badSig)
+
+	if _, ok := hdb.HostByKey(newKey); ok {
+		t.Fatal("rotation with an invalid signature was applied immediately")
+	}
+	if _, tracked := hdb.pendingRotations[addr]; !tracked {
+		t.Fatal("rotation with an invalid signature should fall back to being tracked for the grace period")
+	}
+}
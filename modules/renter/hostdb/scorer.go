@@ -0,0 +1,165 @@
+package hostdb
+
+import (
+	"math/big"
+	"time"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// maxScanHistory bounds the number of scan results retained per host. Older
+// results are discarded once the limit is reached so that scoring reflects
+// recent behavior without the history growing without bound.
+const maxScanHistory = 50
+
+// A ScanRecord is a single entry in a host's scan history: when the scan
+// happened, and whether the host responded successfully.
+type ScanRecord struct {
+	Timestamp time.Time
+	Success   bool
+}
+
+// HostScoreInput bundles the data a HostScorer needs to weigh a host. It is
+// exported so that packages outside hostdb (e.g. renter) can implement their
+// own HostScorer.
+type HostScoreInput struct {
+	Entry         modules.HostDBEntry
+	FirstSeen     types.BlockHeight
+	CurrentHeight types.BlockHeight
+	ScanHistory   []ScanRecord
+}
+
+// A HostScorer assigns a weight to a host. Higher weights make a host more
+// likely to be chosen by RandomHosts and to appear early in ActiveHosts.
+// HostDB.SetScorer lets callers swap in alternative strategies (e.g.
+// price-only or uptime-only) without modifying hostdb itself.
+type HostScorer interface {
+	Score(HostScoreInput) types.Currency
+}
+
+// defaultScorer is the HostScorer used until a caller registers one of its
+// own via HostDB.SetScorer.
+type defaultScorer struct{}
+
+// DefaultScorer is the HostDB's built-in HostScorer. It favors cheap,
+// well-collateralized hosts with a long, reliable scan history, and
+// penalizes hosts that are currently on a run of failed scans.
+var DefaultScorer HostScorer = defaultScorer{}
+
+// baseWeight is the starting point for Score, before the price, collateral,
+// uptime, and age terms are applied. types.Currency is an arbitrary
+// precision *integer* (Hastings), so starting from a weight of 1 and
+// dividing by a host's price would floor straight to zero for any
+// realistic price; baseWeight is large enough that the division instead
+// yields a meaningful fixed-point value.
+var baseWeight = types.NewCurrency(new(big.Int).Exp(big.NewInt(10), big.NewInt(40), nil))
+
+// Score implements HostScorer.
+func (defaultScorer) Score(in HostScoreInput) types.Currency {
+	weight := baseWeight
+
+	// Prefer cheaper storage; a zero price is treated as free and left
+	// unpenalized rather than causing a divide-by-zero.
+	if !in.Entry.StoragePrice.IsZero() {
+		weight = weight.Div(in.Entry.StoragePrice)
+	}
+
+	// Collateral aligns the host's incentives with the renter's, so reward
+	// it directly. Add one to avoid zeroing the weight of hosts that post
+	// no collateral at all.
+	weight = weight.Mul(in.Entry.Collateral.Add(types.NewCurrency64(1)))
+
+	// Reward a track record of uptime. Squaring the ratio punishes
+	// unreliable hosts more than it rewards reliable ones, matching the
+	// old binary "seen in the last 3 days" cutoff's bias toward caution.
+	ratio := uptimeRatio(in.ScanHistory)
+	weight = weight.MulFloat(ratio * ratio)
+
+	// A host currently failing scans is probably offline right now,
+	// regardless of its historical ratio, so apply an additional,
+	// steeply-increasing penalty for consecutive recent failures.
+	if streak := failureStreak(in.ScanHistory); streak > 0 {
+		weight = weight.Div64(uint64(1) << uint(minInt(streak, 16)))
+	}
+
+	// Give a modest boost to hosts with a longer track record; a host
+	// that's been around for a while has had more opportunity to prove
+	// itself than one that was just announced.
+	if in.CurrentHeight > in.FirstSeen {
+		age := in.CurrentHeight - in.FirstSeen
+		weight = weight.MulFloat(1 + ageBonus(age))
+	}
+
+	return weight
+}
+
+// ageBonus returns a small, diminishing bonus for hosts that have been
+// known for longer, capped so that very old hosts don't dominate purely by
+// virtue of age.
+func ageBonus(age types.BlockHeight) float64 {
+	const halfLife = 2000 // ~2 weeks of blocks
+	bonus := float64(age) / float64(age+halfLife)
+	return bonus * 0.5
+}
+
+// uptimeRatio returns the fraction of history's scans that succeeded. A
+// host with no history yet is given the benefit of the doubt.
+func uptimeRatio(history []ScanRecord) float64 {
+	if len(history) == 0 {
+		return 1
+	}
+	var successes int
+	for _, r := range history {
+		if r.Success {
+			successes++
+		}
+	}
+	return float64(successes) / float64(len(history))
+}
+
+// failureStreak returns the number of consecutive failed scans at the end
+// of history.
+func failureStreak(history []ScanRecord) int {
+	var streak int
+	for i := len(history) - 1; i >= 0; i-- {
+		if history[i].Success {
+			break
+		}
+		streak++
+	}
+	return streak
+}
+
+// minInt returns the smaller of a and b.
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// scoreHost scores entry using hdb's current scorer, falling back to
+// DefaultScorer if none has been registered.
+func (hdb *HostDB) scoreHost(entry *hostEntry) types.Currency {
+	scorer := hdb.scorer
+	if scorer == nil {
+		scorer = DefaultScorer
+	}
+	return scorer.Score(HostScoreInput{
+		Entry:         entry.HostDBEntry,
+		FirstSeen:     entry.FirstSeen,
+		CurrentHeight: hdb.blockHeight,
+		ScanHistory:   entry.ScanHistory,
+	})
+}
+
+// SetScorer replaces the HostDB's HostScorer. It is safe to call at any
+// time; hosts are rescored as they are evaluated by ActiveHosts and
+// RandomHosts, so the new scorer takes effect on the next selection rather
+// than requiring a rescan.
+func (hdb *HostDB) SetScorer(s HostScorer) {
+	hdb.mu.Lock()
+	defer hdb.mu.Unlock()
+	hdb.scorer = s
+}
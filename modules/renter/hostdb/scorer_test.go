@@ -0,0 +1,67 @@
+package hostdb
+
+import (
+	"testing"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestDefaultScorerPrefersCheaperHost verifies that, all else equal, a
+// cheaper host scores higher than a pricier one. Before baseWeight was
+// introduced this did not hold for any realistic price: starting from a
+// weight of 1 and dividing by an integer-valued price floored straight to
+// zero.
+func TestDefaultScorerPrefersCheaperHost(t *testing.T) {
+	var cheap, pricey modules.HostDBEntry
+	cheap.Collateral = types.NewCurrency64(100)
+	pricey.Collateral = types.NewCurrency64(100)
+	cheap.StoragePrice = types.NewCurrency64(10)
+	pricey.StoragePrice = types.NewCurrency64(1000)
+
+	cheapScore := DefaultScorer.Score(HostScoreInput{Entry: cheap})
+	priceyScore := DefaultScorer.Score(HostScoreInput{Entry: pricey})
+
+	if cheapScore.IsZero() {
+		t.Fatal("cheap host scored zero")
+	}
+	if cheapScore.Cmp(priceyScore) <= 0 {
+		t.Fatalf("expected cheaper host to score higher: cheap=%v pricey=%v", cheapScore, priceyScore)
+	}
+}
+
+// TestDefaultScorerPrefersMoreCollateral verifies that, all else equal, a
+// host posting more collateral scores higher.
+func TestDefaultScorerPrefersMoreCollateral(t *testing.T) {
+	var low, high modules.HostDBEntry
+	low.StoragePrice = types.NewCurrency64(10)
+	high.StoragePrice = types.NewCurrency64(10)
+	low.Collateral = types.NewCurrency64(1)
+	high.Collateral = types.NewCurrency64(1000)
+
+	lowScore := DefaultScorer.Score(HostScoreInput{Entry: low})
+	highScore := DefaultScorer.Score(HostScoreInput{Entry: high})
+
+	if highScore.Cmp(lowScore) <= 0 {
+		t.Fatalf("expected more-collateralized host to score higher: low=%v high=%v", lowScore, highScore)
+	}
+}
+
+// TestDefaultScorerPenalizesFailureStreak verifies that a host on a run of
+// recent failed scans scores lower than an otherwise-identical host with a
+// clean history.
+func TestDefaultScorerPenalizesFailureStreak(t *testing.T) {
+	var entry modules.HostDBEntry
+	entry.StoragePrice = types.NewCurrency64(10)
+	entry.Collateral = types.NewCurrency64(100)
+
+	clean := []ScanRecord{{Success: true}, {Success: true}, {Success: true}}
+	failing := []ScanRecord{{Success: true}, {Success: false}, {Success: false}}
+
+	cleanScore := DefaultScorer.Score(HostScoreInput{Entry: entry, ScanHistory: clean})
+	failingScore := DefaultScorer.Score(HostScoreInput{Entry: entry, ScanHistory: failing})
+
+	if cleanScore.Cmp(failingScore) <= 0 {
+		t.Fatalf("expected a clean history to score higher than a failure streak: clean=%v failing=%v", cleanScore, failingScore)
+	}
+}